@@ -0,0 +1,57 @@
+package main
+
+import "testing"
+
+func TestMatchAnyGlob(t *testing.T) {
+	if !matchAnyGlob("app.log", []string{"*.log"}) {
+		t.Errorf("expected app.log to match *.log")
+	}
+	if matchAnyGlob("app.gz", []string{"*.log"}) {
+		t.Errorf("expected app.gz not to match *.log")
+	}
+	if !matchAnyGlob("app.gz", []string{"*.log", "*.gz"}) {
+		t.Errorf("expected app.gz to match one of several patterns")
+	}
+}
+
+func TestDirOptionsAllowed(t *testing.T) {
+	cases := []struct {
+		name string
+		opts DirOptions
+		path string
+		want bool
+	}{
+		{
+			name: "no include means everything allowed by default",
+			opts: DirOptions{},
+			path: "/var/log/app.log",
+			want: true,
+		},
+		{
+			name: "include restricts to matching names",
+			opts: DirOptions{Include: []string{"*.log"}},
+			path: "/var/log/app.txt",
+			want: false,
+		},
+		{
+			name: "include allows matching names",
+			opts: DirOptions{Include: []string{"*.log"}},
+			path: "/var/log/app.log",
+			want: true,
+		},
+		{
+			name: "exclude wins over a broad include",
+			opts: DirOptions{Include: []string{"*.log"}, Exclude: []string{"*.gz.log"}},
+			path: "/var/log/app.gz.log",
+			want: false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.opts.allowed(tc.path); got != tc.want {
+				t.Errorf("allowed(%q) = %v, want %v", tc.path, got, tc.want)
+			}
+		})
+	}
+}
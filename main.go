@@ -1,19 +1,31 @@
 package main
 
 import (
-	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
-var wsServer *WebSocketServer
-var watchPath string
+var (
+	wsServer    *WebSocketServer
+	fileWatcher *FileWatcher
+
+	watchPath string // -f/-d 启动时指定的路径
+	isDirMode bool   // 是否以目录模式启动
+	authToken string // 鉴权令牌，为空表示不校验
+)
 
 func main() {
 	filePath := flag.String("f", "", "文件路径")
 	dirPath := flag.String("d", "", "目录路径")
+	token := flag.String("token", "", "鉴权令牌，为空表示不校验")
+	include := flag.String("include", "", "目录模式下包含的文件名 glob 模式，多个用逗号分隔，例如 *.log")
+	exclude := flag.String("exclude", "", "目录模式下排除的文件名 glob 模式，多个用逗号分隔，例如 *.gz")
+	recursive := flag.Bool("recursive", true, "目录模式下是否递归监听子目录")
 
 	// 同时支持 -f/--file 和 -d/--dir 的格式
 	flag.StringVar(filePath, "file", "", "文件路径")
@@ -35,80 +47,235 @@ func main() {
 		os.Exit(1)
 	}
 
+	authToken = *token
+
+	var err error
+	fileWatcher, err = NewFileWatcher()
+	if err != nil {
+		log.Fatalf("NewFileWatcher() error: %v", err)
+	}
+
 	// 启动 websocket 服务
-	wsServer = NewWebSocketServer(onSocketMessage)
+	wsServer = NewWebSocketServer(newRouter())
 	go wsServer.Start("localhost:8081")
 
 	// 如果指定了 -f/--file 参数，则监控文件
 	if *filePath != "" {
 		watchPath = *filePath
-		watcher, err := NewFileWatcher()
-		if err != nil {
-			log.Fatalf("NewFileWatcher() error: %v", err)
+		if err := startWatchingPath(*filePath); err != nil {
+			log.Fatalf("startWatchingPath(%q) error: %v", *filePath, err)
 		}
-		go watcher.WatchFile(*filePath, onFileChange)
 	}
 
-	// // 如果指定了 -d/--dir 参数，则监控目录
+	// 如果指定了 -d/--dir 参数，则监控目录
 	if *dirPath != "" {
 		watchPath = *dirPath
-		go WatchDirectory(*dirPath, onFileChange)
+		isDirMode = true
+		dirOpts := DirOptions{
+			Include:        splitPatterns(*include),
+			Exclude:        splitPatterns(*exclude),
+			Recursive:      *recursive,
+			FollowRotation: true,
+		}
+		if err := fileWatcher.WatchDir(*dirPath, dirOpts, onFileChange); err != nil {
+			log.Fatalf("WatchDir(%q) error: %v", *dirPath, err)
+		}
 	}
 
 	// 启动 http 服务
 	httpServer := NewHTTPServer(":8081")
-	err := httpServer.Start(true)
+	err = httpServer.Start(true)
 	if err != nil {
 		log.Fatalf("httpServer.Start(true) error: %v", err)
 	}
 }
 
-type SocketMessage struct {
-	Type string      `json:"type"`
-	Data interface{} `json:"data"`
+// newRouter 构建消息路由器：注册中间件管道与每种消息类型的 handler
+func newRouter() *Router {
+	router := NewRouter()
+
+	// 中间件按注册顺序从外到内包裹：先恢复 panic，再记录日志，再限流，最后鉴权
+	router.Use(RecoveryMiddleware)
+	router.Use(LoggingMiddleware)
+	router.Use(NewRateLimiter(50, time.Second).Middleware())
+	router.Use(AuthMiddleware(authToken))
+
+	router.Handle("get_info", handleGetInfo)
+	router.Handle("get_file_content", handleGetFileContent)
+	router.Handle("subscribe", handleSubscribe)
+	router.Handle("unsubscribe", handleUnsubscribe)
+	router.Handle("list_watches", handleListWatches)
+	router.Handle("search", handleSearch)
+	router.Handle("ping", handlePing)
+
+	return router
+}
+
+// startWatchingPath 确保某个文件路径处于监听状态，重复调用是安全的。
+// "是否已经在监听"直接问 fileWatcher 本身（它可能是被某次 WatchDir 间接发现并
+// 开始 tail 的），而不是另外维护一份本地记录——否则两者会在目录模式下失去同步。
+func startWatchingPath(path string) error {
+	if fileWatcher.IsWatching(path) {
+		return nil
+	}
+	return fileWatcher.WatchFile(path, onFileChange)
 }
 
-func onSocketMessage(message []byte) ([]byte, error) {
-	msg := SocketMessage{}
-	err := json.Unmarshal(message, &msg)
+// splitPatterns 解析逗号分隔的 glob 模式列表，忽略空白项
+func splitPatterns(s string) []string {
+	if s == "" {
+		return nil
+	}
+	parts := strings.Split(s, ",")
+	patterns := make([]string, 0, len(parts))
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// listDirFiles 枚举目录模式下所有可供订阅的文件
+func listDirFiles(root string) ([]string, error) {
+	files := make([]string, 0)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// handleGetInfo 返回当前监听的路径信息；目录模式下附带可订阅的文件列表
+func handleGetInfo(ctx *Context, req *Request) (*Response, error) {
+	info := map[string]interface{}{
+		"type": "file",
+		"path": watchPath,
+	}
+	if isDirMode {
+		info["type"] = "dir"
+		if files, err := listDirFiles(watchPath); err == nil {
+			info["files"] = files
+		}
+	}
+	return &Response{Type: "info", Data: info}, nil
+}
+
+// handleGetFileContent 返回指定文件的全部内容
+func handleGetFileContent(ctx *Context, req *Request) (*Response, error) {
+	path, ok := req.Data.(string)
+	if !ok {
+		return nil, fmt.Errorf("data 字段必须是文件路径字符串")
+	}
+	content, err := os.ReadFile(path)
 	if err != nil {
-		log.Fatalf("json.Unmarshal(message) error: %v", err)
-		return nil, err
-	}
-	var response interface{}
-	switch msg.Type {
-	case "get_info":
-		response = interface{}(map[string]interface{}{
-			"type": "info",
-			"data": map[string]interface{}{
-				"type": "file",
-				"path": watchPath,
-			},
-		})
-	case "get_file_content":
-		content, err := os.ReadFile(msg.Data.(string))
+		return nil, fmt.Errorf("读取文件失败: %v", err)
+	}
+	return &Response{Type: "file_content", Data: string(content)}, nil
+}
+
+// handleSubscribe 让当前会话订阅某个文件，必要时启动对该文件的监听。
+// 支持的可选参数：filter（子串或正则）、level（日志级别）、
+// level_pattern（用于提取级别的正则，取第一个捕获组）、
+// tail（订阅时先推送最后 N 行历史，再开始推送新增内容）
+func handleSubscribe(ctx *Context, req *Request) (*Response, error) {
+	data, ok := req.Data.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("data 字段格式错误")
+	}
+	path, ok := data["path"].(string)
+	if !ok || path == "" {
+		return nil, fmt.Errorf("缺少 path 参数")
+	}
+	filterPattern, _ := data["filter"].(string)
+	level, _ := data["level"].(string)
+	levelPattern, _ := data["level_pattern"].(string)
+	tailN := intFromData(data["tail"])
+
+	if err := startWatchingPath(path); err != nil {
+		return nil, fmt.Errorf("订阅失败 %s: %v", path, err)
+	}
+
+	filter, err := buildLineFilter(filterPattern, level, levelPattern)
+	if err != nil {
+		return nil, fmt.Errorf("过滤条件无效: %v", err)
+	}
+	ctx.Server.Subscribe(ctx.SID, path, filter)
+
+	respData := map[string]interface{}{"path": path}
+	if tailN > 0 {
+		lines, err := fileWatcher.Snapshot(path, tailN)
 		if err != nil {
-			log.Fatalf("os.ReadFile(msg.Data.(string)) error: %v", err)
-			return nil, err
+			return nil, fmt.Errorf("读取历史内容失败: %v", err)
 		}
-		response = interface{}(map[string]interface{}{
-			"type": "file_content",
-			"data": string(content),
-		})
-	case "ping":
-		response = interface{}(map[string]interface{}{
-			"type": "pong",
-		})
+		respData["history"] = filterLines(lines, filter)
+	}
+
+	return &Response{Type: "subscribed", Data: respData}, nil
+}
+
+// intFromData 从 JSON 解码得到的 interface{} 中取出整数，JSON 数字默认解码为 float64
+func intFromData(v interface{}) int {
+	switch n := v.(type) {
+	case float64:
+		return int(n)
+	case int:
+		return n
 	default:
-		return nil, fmt.Errorf("未知的消息类型: %s", msg.Type)
+		return 0
+	}
+}
+
+// handleUnsubscribe 取消当前会话对某个文件的订阅
+func handleUnsubscribe(ctx *Context, req *Request) (*Response, error) {
+	data, ok := req.Data.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("data 字段格式错误")
+	}
+	path, ok := data["path"].(string)
+	if !ok || path == "" {
+		return nil, fmt.Errorf("缺少 path 参数")
+	}
+
+	ctx.Server.Unsubscribe(ctx.SID, path)
+	return &Response{Type: "unsubscribed", Data: map[string]interface{}{"path": path}}, nil
+}
+
+// handleSearch 在指定文件的全部内容中查找匹配 pattern 的行，返回行号与上下文
+func handleSearch(ctx *Context, req *Request) (*Response, error) {
+	data, ok := req.Data.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("data 字段格式错误")
 	}
+	path, _ := data["path"].(string)
+	pattern, _ := data["pattern"].(string)
+	if path == "" || pattern == "" {
+		return nil, fmt.Errorf("缺少 path 或 pattern 参数")
+	}
+	contextLines := intFromData(data["context"])
 
-	msgStr, err := json.Marshal(response)
+	results, err := fileWatcher.Search(path, pattern, contextLines)
 	if err != nil {
-		log.Fatalf("json.Marshal(msg) error: %v", err)
-		return nil, err
+		return nil, fmt.Errorf("搜索失败: %v", err)
 	}
-	return msgStr, nil
+
+	return &Response{Type: "search_result", Data: results}, nil
+}
+
+// handleListWatches 返回当前会话订阅的所有文件路径
+func handleListWatches(ctx *Context, req *Request) (*Response, error) {
+	return &Response{Type: "watches", Data: ctx.Server.ListWatches(ctx.SID)}, nil
+}
+
+// handlePing 简单的心跳检测
+func handlePing(ctx *Context, req *Request) (*Response, error) {
+	return &Response{Type: "pong"}, nil
 }
 
 func onFileChange(change FileChange) {
@@ -125,13 +292,6 @@ func onFileChange(change FileChange) {
 		}
 	}
 	fmt.Println("------------------------")
-	msg := interface{}(map[string]interface{}{
-		"type": "log",
-		"data": change,
-	})
-	msgStr, err := json.Marshal(msg)
-	if err != nil {
-		log.Fatalf("json.Marshal(msg) error: %v", err)
-	}
-	wsServer.broadcast <- msgStr
+
+	wsServer.PublishChange(change)
 }
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Request 客户端发来的请求帧
+type Request struct {
+	ID    string      `json:"id"`              // 由客户端生成，响应会原样带回，用于匹配异步回复
+	Type  string      `json:"type"`            // 请求类型，对应已注册的 handler
+	Token string      `json:"token,omitempty"` // 鉴权令牌
+	Data  interface{} `json:"data"`
+}
+
+// Response 服务端返回的响应帧
+type Response struct {
+	ID   string      `json:"id"`
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// Event 服务端主动推送的事件帧，与请求/响应帧通过 type:"event" 区分
+type Event struct {
+	Type    string      `json:"type"` // 固定为 "event"
+	Channel string      `json:"channel"`
+	Data    interface{} `json:"data"`
+}
+
+// Context 贯穿一次请求处理的上下文
+type Context struct {
+	SID    string
+	Server *WebSocketServer
+	Client *Client
+}
+
+// HandlerFunc 处理一种消息类型的业务逻辑
+type HandlerFunc func(ctx *Context, req *Request) (*Response, error)
+
+// Middleware 包裹 HandlerFunc，用于实现日志、恢复、鉴权、限流等横切逻辑
+type Middleware func(HandlerFunc) HandlerFunc
+
+// Router 根据消息类型分发请求，并在处理前后应用中间件管道
+type Router struct {
+	mutex      sync.RWMutex
+	handlers   map[string]HandlerFunc
+	middleware []Middleware
+}
+
+// NewRouter 创建一个空的 Router
+func NewRouter() *Router {
+	return &Router{
+		handlers: make(map[string]HandlerFunc),
+	}
+}
+
+// Use 注册一个中间件，按注册顺序从外到内包裹 handler
+func (r *Router) Use(mw Middleware) {
+	r.middleware = append(r.middleware, mw)
+}
+
+// Handle 注册某种消息类型的处理函数
+func (r *Router) Handle(msgType string, handler HandlerFunc) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.handlers[msgType] = handler
+}
+
+// Dispatch 解析一帧原始消息，执行中间件管道与对应 handler，返回可直接发送的响应帧
+func (r *Router) Dispatch(ctx *Context, raw []byte) []byte {
+	var req Request
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return encodeError("", "bad_request", fmt.Sprintf("无效的消息格式: %v", err))
+	}
+
+	r.mutex.RLock()
+	handler, ok := r.handlers[req.Type]
+	r.mutex.RUnlock()
+	if !ok {
+		return encodeError(req.ID, "unknown_type", fmt.Sprintf("未知的消息类型: %s", req.Type))
+	}
+
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		handler = r.middleware[i](handler)
+	}
+
+	resp, err := handler(ctx, &req)
+	if err != nil {
+		return encodeError(req.ID, "handler_error", err.Error())
+	}
+
+	resp.ID = req.ID
+	if resp.Type == "" {
+		resp.Type = "response"
+	}
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return encodeError(req.ID, "encode_error", err.Error())
+	}
+	return data
+}
+
+// encodeError 构造一个 {type:"error", id, code, message} 错误帧
+func encodeError(id, code, message string) []byte {
+	frame := map[string]interface{}{
+		"type":    "error",
+		"id":      id,
+		"code":    code,
+		"message": message,
+	}
+	data, err := json.Marshal(frame)
+	if err != nil {
+		// 理论上不会发生，兜底返回一个静态错误帧
+		return []byte(`{"type":"error","code":"encode_error","message":"无法编码错误信息"}`)
+	}
+	return data
+}
+
+// encodeEvent 构造一个 {type:"event", channel, data} 推送帧
+func encodeEvent(channel string, data interface{}) ([]byte, error) {
+	return json.Marshal(Event{Type: "event", Channel: channel, Data: data})
+}
+
+// LoggingMiddleware 记录每次请求的处理情况
+func LoggingMiddleware(next HandlerFunc) HandlerFunc {
+	return func(ctx *Context, req *Request) (*Response, error) {
+		resp, err := next(ctx, req)
+		if err != nil {
+			log.Printf("[%s] %s (id=%s) 处理失败: %v", ctx.SID, req.Type, req.ID, err)
+		} else {
+			log.Printf("[%s] %s (id=%s) 处理完成", ctx.SID, req.Type, req.ID)
+		}
+		return resp, err
+	}
+}
+
+// RecoveryMiddleware 捕获 handler 中的 panic，转换为普通错误，避免单个请求拖垮整个连接
+func RecoveryMiddleware(next HandlerFunc) HandlerFunc {
+	return func(ctx *Context, req *Request) (resp *Response, err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				log.Printf("[%s] %s 处理时发生 panic: %v", ctx.SID, req.Type, p)
+				resp = nil
+				err = fmt.Errorf("内部错误: %v", p)
+			}
+		}()
+		return next(ctx, req)
+	}
+}
+
+// AuthMiddleware 校验请求携带的 token，token 为空字符串时表示不启用鉴权
+func AuthMiddleware(requiredToken string) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx *Context, req *Request) (*Response, error) {
+			if requiredToken != "" && req.Token != requiredToken {
+				return nil, fmt.Errorf("未授权的请求")
+			}
+			return next(ctx, req)
+		}
+	}
+}
+
+// RateLimiter 基于固定时间窗口的简单限流器
+type RateLimiter struct {
+	mutex    sync.Mutex
+	limit    int
+	window   time.Duration
+	counters map[string]*rateCounter
+}
+
+type rateCounter struct {
+	count   int
+	resetAt time.Time
+}
+
+// NewRateLimiter 创建一个限流器：每个会话在 window 时间内最多允许 limit 次请求
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	return &RateLimiter{
+		limit:    limit,
+		window:   window,
+		counters: make(map[string]*rateCounter),
+	}
+}
+
+// allow 判断某个会话在当前时间窗口内是否还允许发起请求
+func (rl *RateLimiter) allow(sid string) bool {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	now := time.Now()
+	c, ok := rl.counters[sid]
+	if !ok || now.After(c.resetAt) {
+		c = &rateCounter{resetAt: now.Add(rl.window)}
+		rl.counters[sid] = c
+	}
+	c.count++
+	return c.count <= rl.limit
+}
+
+// Middleware 返回可注册到 Router 的限流中间件
+func (rl *RateLimiter) Middleware() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx *Context, req *Request) (*Response, error) {
+			if !rl.allow(ctx.SID) {
+				return nil, fmt.Errorf("请求过于频繁，请稍后再试")
+			}
+			return next(ctx, req)
+		}
+	}
+}
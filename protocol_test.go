@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func decodeFrame(t *testing.T, raw []byte) map[string]interface{} {
+	t.Helper()
+	var frame map[string]interface{}
+	if err := json.Unmarshal(raw, &frame); err != nil {
+		t.Fatalf("failed to decode frame: %v", err)
+	}
+	return frame
+}
+
+func TestDispatchUnknownType(t *testing.T) {
+	r := NewRouter()
+	frame := decodeFrame(t, r.Dispatch(&Context{}, []byte(`{"id":"1","type":"nope"}`)))
+	if frame["type"] != "error" || frame["code"] != "unknown_type" {
+		t.Errorf("expected unknown_type error, got %v", frame)
+	}
+}
+
+func TestDispatchBadRequest(t *testing.T) {
+	r := NewRouter()
+	frame := decodeFrame(t, r.Dispatch(&Context{}, []byte(`not json`)))
+	if frame["type"] != "error" || frame["code"] != "bad_request" {
+		t.Errorf("expected bad_request error, got %v", frame)
+	}
+}
+
+func TestDispatchHandlerError(t *testing.T) {
+	r := NewRouter()
+	r.Handle("boom", func(ctx *Context, req *Request) (*Response, error) {
+		return nil, fmt.Errorf("kaboom")
+	})
+
+	frame := decodeFrame(t, r.Dispatch(&Context{}, []byte(`{"id":"1","type":"boom"}`)))
+	if frame["type"] != "error" || frame["code"] != "handler_error" {
+		t.Errorf("expected handler_error, got %v", frame)
+	}
+}
+
+func TestDispatchSuccessCarriesRequestID(t *testing.T) {
+	r := NewRouter()
+	r.Handle("echo", func(ctx *Context, req *Request) (*Response, error) {
+		return &Response{Data: req.Data}, nil
+	})
+
+	frame := decodeFrame(t, r.Dispatch(&Context{}, []byte(`{"id":"abc","type":"echo","data":"hi"}`)))
+	if frame["id"] != "abc" {
+		t.Errorf("expected response id to echo request id, got %v", frame["id"])
+	}
+	if frame["type"] != "response" {
+		t.Errorf("expected default response type \"response\", got %v", frame["type"])
+	}
+	if frame["data"] != "hi" {
+		t.Errorf("expected data to round-trip, got %v", frame["data"])
+	}
+}
+
+func TestDispatchMiddlewareRunsOuterToInner(t *testing.T) {
+	r := NewRouter()
+	var order []string
+
+	wrap := func(name string) Middleware {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(ctx *Context, req *Request) (*Response, error) {
+				order = append(order, name)
+				return next(ctx, req)
+			}
+		}
+	}
+	// Use 按注册顺序从外到内包裹：第一个注册的中间件最先执行
+	r.Use(wrap("first"))
+	r.Use(wrap("second"))
+	r.Handle("ping", func(ctx *Context, req *Request) (*Response, error) {
+		order = append(order, "handler")
+		return &Response{}, nil
+	})
+
+	r.Dispatch(&Context{}, []byte(`{"id":"1","type":"ping"}`))
+
+	want := "first,second,handler"
+	got := ""
+	for i, name := range order {
+		if i > 0 {
+			got += ","
+		}
+		got += name
+	}
+	if got != want {
+		t.Errorf("expected middleware order %q, got %q", want, got)
+	}
+}
+
+func TestRecoveryMiddlewareCatchesPanic(t *testing.T) {
+	r := NewRouter()
+	r.Use(RecoveryMiddleware)
+	r.Handle("panics", func(ctx *Context, req *Request) (*Response, error) {
+		panic("boom")
+	})
+
+	frame := decodeFrame(t, r.Dispatch(&Context{}, []byte(`{"id":"1","type":"panics"}`)))
+	if frame["type"] != "error" || frame["code"] != "handler_error" {
+		t.Errorf("expected a recovered panic to surface as handler_error, got %v", frame)
+	}
+}
+
+func TestAuthMiddlewareRejectsWrongToken(t *testing.T) {
+	r := NewRouter()
+	r.Use(AuthMiddleware("secret"))
+	r.Handle("ping", func(ctx *Context, req *Request) (*Response, error) {
+		return &Response{}, nil
+	})
+
+	frame := decodeFrame(t, r.Dispatch(&Context{}, []byte(`{"id":"1","type":"ping","token":"wrong"}`)))
+	if frame["type"] != "error" {
+		t.Errorf("expected auth failure to be rejected, got %v", frame)
+	}
+
+	frame = decodeFrame(t, r.Dispatch(&Context{}, []byte(`{"id":"1","type":"ping","token":"secret"}`)))
+	if frame["type"] != "response" {
+		t.Errorf("expected matching token to pass, got %v", frame)
+	}
+}
+
+func TestAuthMiddlewareDisabledWhenTokenEmpty(t *testing.T) {
+	r := NewRouter()
+	r.Use(AuthMiddleware(""))
+	r.Handle("ping", func(ctx *Context, req *Request) (*Response, error) {
+		return &Response{}, nil
+	})
+
+	frame := decodeFrame(t, r.Dispatch(&Context{}, []byte(`{"id":"1","type":"ping"}`)))
+	if frame["type"] != "response" {
+		t.Errorf("expected no auth required when token is empty, got %v", frame)
+	}
+}
+
+func TestRateLimiterAllowsUpToLimit(t *testing.T) {
+	rl := NewRateLimiter(2, time.Minute)
+
+	if !rl.allow("sid-1") {
+		t.Errorf("expected first request to be allowed")
+	}
+	if !rl.allow("sid-1") {
+		t.Errorf("expected second request to be allowed")
+	}
+	if rl.allow("sid-1") {
+		t.Errorf("expected third request within the window to be rejected")
+	}
+
+	// 另一个会话有自己独立的计数
+	if !rl.allow("sid-2") {
+		t.Errorf("expected a different session to have its own counter")
+	}
+}
+
+func TestRateLimiterResetsAfterWindow(t *testing.T) {
+	rl := NewRateLimiter(1, 20*time.Millisecond)
+
+	if !rl.allow("sid-1") {
+		t.Errorf("expected first request to be allowed")
+	}
+	if rl.allow("sid-1") {
+		t.Errorf("expected second request within the window to be rejected")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if !rl.allow("sid-1") {
+		t.Errorf("expected request after window reset to be allowed again")
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// knownLevels 按常见约定识别的日志级别，用于 level 过滤
+var knownLevels = []string{"DEBUG", "INFO", "WARN", "WARNING", "ERROR", "FATAL"}
+
+// compileFilter 编译用户传入的过滤表达式：优先当作正则表达式编译，
+// 失败时退化为按字面量子串匹配（转义后编译），这样普通子串搜索也能直接使用
+func compileFilter(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	if re, err := regexp.Compile(pattern); err == nil {
+		return re, nil
+	}
+	return regexp.Compile(regexp.QuoteMeta(pattern))
+}
+
+// detectLevel 从一行日志中识别日志级别。
+// levelPattern 非空时，使用其第一个捕获组的值作为级别；
+// 否则按 [INFO]、ERROR: 这类常见前缀猜测
+func detectLevel(line, levelPattern string) string {
+	if levelPattern != "" {
+		re, err := regexp.Compile(levelPattern)
+		if err != nil {
+			return ""
+		}
+		if m := re.FindStringSubmatch(line); len(m) > 1 {
+			return strings.ToUpper(m[1])
+		}
+		return ""
+	}
+
+	for _, lv := range knownLevels {
+		if strings.Contains(line, "["+lv+"]") || strings.HasPrefix(strings.TrimSpace(line), lv+":") {
+			return lv
+		}
+	}
+	return ""
+}
+
+// lineFilter 描述一个订阅的过滤条件：正则/子串匹配 加上 可选的日志级别匹配
+type lineFilter struct {
+	re           *regexp.Regexp
+	level        string
+	levelPattern string
+}
+
+// buildLineFilter 根据 subscribe 请求携带的 filter/level 参数构造过滤器，两者均为空时返回 nil（不过滤）
+func buildLineFilter(pattern, level, levelPattern string) (*lineFilter, error) {
+	if pattern == "" && level == "" {
+		return nil, nil
+	}
+
+	re, err := compileFilter(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	return &lineFilter{re: re, level: strings.ToUpper(level), levelPattern: levelPattern}, nil
+}
+
+// match 判断一行内容是否满足过滤条件，nil 过滤器视为全部匹配
+func (f *lineFilter) match(line string) bool {
+	if f == nil {
+		return true
+	}
+	if f.re != nil && !f.re.MatchString(line) {
+		return false
+	}
+	if f.level != "" && detectLevel(line, f.levelPattern) != f.level {
+		return false
+	}
+	return true
+}
+
+// filterLines 按过滤器筛选一组历史行，用于 tail-N 快照
+func filterLines(lines []string, filter *lineFilter) []string {
+	if filter == nil {
+		return lines
+	}
+	filtered := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if filter.match(line) {
+			filtered = append(filtered, line)
+		}
+	}
+	return filtered
+}
+
+// filterChange 按过滤器筛选一次文件变化中的行级变更；
+// 非 modified 类型（如 rotated）始终放行；
+// 过滤后一行都不剩时返回 nil，表示这次变化不应推送给该订阅者
+func filterChange(change FileChange, filter *lineFilter) *FileChange {
+	if filter == nil || change.Op != "modified" {
+		return &change
+	}
+
+	matched := make([]LineChange, 0, len(change.LineChanges))
+	for _, lc := range change.LineChanges {
+		text := lc.NewText
+		if text == "" {
+			text = lc.OldText
+		}
+		if filter.match(text) {
+			matched = append(matched, lc)
+		}
+	}
+	if len(matched) == 0 {
+		return nil
+	}
+
+	filtered := change
+	filtered.LineChanges = matched
+	return &filtered
+}
@@ -0,0 +1,108 @@
+package main
+
+import "testing"
+
+func TestCompileFilterRegexAndLiteral(t *testing.T) {
+	re, err := compileFilter(`err\d+`)
+	if err != nil {
+		t.Fatalf("unexpected error compiling regex: %v", err)
+	}
+	if !re.MatchString("err42") {
+		t.Errorf("expected regex to match err42")
+	}
+
+	// 不是合法正则时退化为字面量子串匹配（转义后编译）
+	re, err = compileFilter("a(b")
+	if err != nil {
+		t.Fatalf("unexpected error falling back to literal match: %v", err)
+	}
+	if !re.MatchString("xa(bx") {
+		t.Errorf("expected literal match for a(b")
+	}
+
+	re, err = compileFilter("")
+	if err != nil || re != nil {
+		t.Errorf("expected nil regex and nil error for empty pattern, got %v, %v", re, err)
+	}
+}
+
+func TestLineFilterMatch(t *testing.T) {
+	filter, err := buildLineFilter("fail", "ERROR", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !filter.match("[ERROR] request failed") {
+		t.Errorf("expected line to match pattern+level")
+	}
+	if filter.match("[ERROR] all good") {
+		t.Errorf("expected line without pattern match to be rejected")
+	}
+	if filter.match("[INFO] request failed") {
+		t.Errorf("expected line with wrong level to be rejected")
+	}
+}
+
+func TestBuildLineFilterEmptyIsNil(t *testing.T) {
+	filter, err := buildLineFilter("", "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if filter != nil {
+		t.Fatalf("expected nil filter when pattern and level are both empty")
+	}
+	if !filter.match("anything") {
+		t.Errorf("nil filter should match everything")
+	}
+}
+
+func TestFilterChangePartialMatch(t *testing.T) {
+	filter, err := buildLineFilter("keep", "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	change := FileChange{
+		Op: "modified",
+		LineChanges: []LineChange{
+			{Type: "added", NewText: "please keep this"},
+			{Type: "added", NewText: "drop this"},
+		},
+	}
+
+	filtered := filterChange(change, filter)
+	if filtered == nil {
+		t.Fatalf("expected a non-nil result when at least one line matches")
+	}
+	if len(filtered.LineChanges) != 1 || filtered.LineChanges[0].NewText != "please keep this" {
+		t.Errorf("expected only the matching line to survive, got %+v", filtered.LineChanges)
+	}
+}
+
+func TestFilterChangeDropsWhenNothingMatches(t *testing.T) {
+	filter, err := buildLineFilter("nope", "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	change := FileChange{
+		Op:          "modified",
+		LineChanges: []LineChange{{Type: "added", NewText: "irrelevant"}},
+	}
+
+	if filtered := filterChange(change, filter); filtered != nil {
+		t.Errorf("expected nil when no line matches, got %+v", filtered)
+	}
+}
+
+func TestFilterChangeAlwaysPassesNonModified(t *testing.T) {
+	filter, err := buildLineFilter("nope", "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	change := FileChange{Op: "rotated"}
+	if filtered := filterChange(change, filter); filtered == nil {
+		t.Errorf("expected non-modified changes to always pass through")
+	}
+}
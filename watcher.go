@@ -16,6 +16,16 @@ import (
 
 type FileEventCallback func(FileChange)
 
+// WatchMode 文件监听模式
+type WatchMode string
+
+const (
+	// ModeTail 追加模式：只读取新增的内容（tail -f 行为），适用于持续增长的日志文件
+	ModeTail WatchMode = "tail"
+	// ModeDiff 全量比对模式：每次变化都重新读取整个文件并做 LCS 差异比较，仅适用于较小的配置类文件
+	ModeDiff WatchMode = "diff"
+)
+
 // FileChange 文件变化信息结构
 type FileChange struct {
 	Path        string       `json:"path"`         // 文件路径
@@ -35,24 +45,149 @@ type LineChange struct {
 	NewText string `json:"new_text"` // 新内容
 }
 
-// FileWatcher 文件监视器
+// tailState 追加模式下单个文件的读取状态
+type tailState struct {
+	info           os.FileInfo // 最近一次 stat 的结果，用于通过 SameFile 判断是否发生了轮转
+	offset         int64       // 已读取到的文件偏移量
+	lastLine       int         // 已经发出的行号
+	partial        []byte      // 尚未遇到换行符的残余内容
+	followRotation bool        // 是否检测并上报日志轮转/截断
+}
+
+// DirOptions 目录监听的行为配置
+type DirOptions struct {
+	Include        []string // 包含的 glob 模式（匹配文件名），为空表示包含所有文件，例如 "*.log"
+	Exclude        []string // 排除的 glob 模式，例如 "*.gz"
+	Recursive      bool     // 是否递归监听新建的子目录
+	FollowRotation bool     // 是否对目录下的文件启用轮转检测，与单文件模式一致
+}
+
+// allowed 判断某个文件是否满足 Include/Exclude 规则
+func (opts DirOptions) allowed(path string) bool {
+	name := filepath.Base(path)
+	if len(opts.Include) > 0 && !matchAnyGlob(name, opts.Include) {
+		return false
+	}
+	return !matchAnyGlob(name, opts.Exclude)
+}
+
+// matchAnyGlob 判断 name 是否匹配 patterns 中的任意一个 glob 模式
+func matchAnyGlob(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// dirWatch 一次目录监听的运行时状态
+type dirWatch struct {
+	opts     DirOptions
+	callback FileEventCallback
+}
+
+// FileWatcher 文件监视器：底层共享同一个 fsnotify.Watcher 和同一条事件流，
+// 既可以单独监听文件，也可以监听整个目录，两者的缓存/偏移量状态互不冲突
 type FileWatcher struct {
-	watcher    *fsnotify.Watcher
-	fileCache  map[string]string // 缓存文件内容
+	watcher *fsnotify.Watcher
+
+	fileCache  map[string]string // diff 模式下缓存的文件内容
 	cacheMutex sync.RWMutex
+
+	modes      map[string]WatchMode // 每个文件使用的监听模式
+	modesMutex sync.RWMutex
+
+	tails     map[string]*tailState // tail 模式下每个文件的读取状态
+	tailMutex sync.Mutex
+
+	callbacks      map[string]FileEventCallback // 每个文件路径对应的回调
+	callbacksMutex sync.RWMutex
+
+	// watchedDirs 记录每个被 fsnotify 监听的目录属于哪次 WatchDir 调用，
+	// 用于在收到事件时判断该事件来自目录监听还是单文件监听
+	watchedDirs map[string]*dirWatch
+	dirsMutex   sync.RWMutex
 }
 
-// NewFileWatcher 创建新的文件监视器
+// NewFileWatcher 创建新的文件监视器，并启动唯一的事件分发循环
 func NewFileWatcher() (*FileWatcher, error) {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return nil, err
 	}
 
-	return &FileWatcher{
-		watcher:   watcher,
-		fileCache: make(map[string]string),
-	}, nil
+	fw := &FileWatcher{
+		watcher:     watcher,
+		fileCache:   make(map[string]string),
+		modes:       make(map[string]WatchMode),
+		tails:       make(map[string]*tailState),
+		callbacks:   make(map[string]FileEventCallback),
+		watchedDirs: make(map[string]*dirWatch),
+	}
+	go fw.eventLoop()
+	return fw, nil
+}
+
+// eventLoop 是整个 FileWatcher 唯一的事件消费者，所有被监听的文件和目录共享这一条事件流。
+//
+// 这一单一事件循环的设计，除了是本次目录监听改造的基础，也顺带修掉了一个早期遗留问题：
+// 改造前 WatchFile 每次调用都单独启动一个 goroutine
+// 去读取 fw.watcher.Events/Errors——但 FileWatcher 底层只有一个 fsnotify.Watcher，这些
+// goroutine 会一直竞争同一条事件流且从不退出，每多监听一个文件就泄漏一个。
+// 改为这里的单一事件循环后该问题不再存在：WatchFile/WatchFileMode 此后只注册状态，不再起 goroutine。
+func (fw *FileWatcher) eventLoop() {
+	for {
+		select {
+		case event, ok := <-fw.watcher.Events:
+			if !ok {
+				return
+			}
+			log.Printf("文件变化: %v\n", event.Name)
+			fw.handleEvent(event)
+		case err, ok := <-fw.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("监听错误: %v\n", err)
+		}
+	}
+}
+
+// handleEvent 根据事件路径所属的范围（目录监听 or 单文件监听）分别处理
+func (fw *FileWatcher) handleEvent(event fsnotify.Event) {
+	if dw, ok := fw.findDirWatch(event.Name); ok {
+		fw.handleDirEvent(event, dw)
+		return
+	}
+
+	fw.modesMutex.RLock()
+	mode, known := fw.modes[event.Name]
+	fw.modesMutex.RUnlock()
+	if !known {
+		return
+	}
+
+	fw.callbacksMutex.RLock()
+	callback := fw.callbacks[event.Name]
+	fw.callbacksMutex.RUnlock()
+
+	if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) {
+		return
+	}
+	if mode == ModeDiff {
+		fw.handleDiffChange(event.Name, callback)
+	} else {
+		fw.handleTailChange(event.Name, callback)
+	}
+}
+
+// findDirWatch 判断一个事件路径是否位于某次 WatchDir 调用监听的目录范围内
+func (fw *FileWatcher) findDirWatch(path string) (*dirWatch, bool) {
+	fw.dirsMutex.RLock()
+	defer fw.dirsMutex.RUnlock()
+	dw, ok := fw.watchedDirs[filepath.Dir(path)]
+	return dw, ok
 }
 
 // compareLines 比较两个文本的差异
@@ -111,8 +246,197 @@ func (fw *FileWatcher) compareLines(oldContent, newContent string) []LineChange
 	return changes
 }
 
-// WatchFile 监听单个文件的变化
+// WatchFile 监听单个文件的变化，默认使用追加（tail）模式
 func (fw *FileWatcher) WatchFile(filePath string, callback func(FileChange)) error {
+	return fw.WatchFileMode(filePath, ModeTail, callback)
+}
+
+// IsWatching 判断某个文件当前是否已经处于监听状态，无论这个状态是由 WatchFile/
+// WatchFileMode 直接建立的，还是作为某次 WatchDir 发现的文件间接建立的。
+// 调用方应该用它代替自行维护一份"是否已经监听过"的记录——fw.modes 就是
+// FileWatcher 对外唯一需要的真相来源，别处另起一份账本迟早会和它失去同步。
+func (fw *FileWatcher) IsWatching(filePath string) bool {
+	fw.modesMutex.RLock()
+	defer fw.modesMutex.RUnlock()
+	_, known := fw.modes[filePath]
+	return known
+}
+
+// WatchFileMode 以指定模式监听单个文件的变化
+func (fw *FileWatcher) WatchFileMode(filePath string, mode WatchMode, callback func(FileChange)) error {
+	fw.modesMutex.Lock()
+	fw.modes[filePath] = mode
+	fw.modesMutex.Unlock()
+
+	fw.callbacksMutex.Lock()
+	fw.callbacks[filePath] = callback
+	fw.callbacksMutex.Unlock()
+
+	if mode == ModeDiff {
+		return fw.watchFileDiff(filePath)
+	}
+	return fw.watchFileTail(filePath, true)
+}
+
+// watchFileTail 以追加模式监听文件：只读取自上次偏移量之后新增的内容
+func (fw *FileWatcher) watchFileTail(filePath string, followRotation bool) error {
+	if err := fw.startTailState(filePath, followRotation); err != nil {
+		return err
+	}
+
+	if err := fw.watcher.Add(filePath); err != nil {
+		return fmt.Errorf("添加文件监听失败: %v", err)
+	}
+	return nil
+}
+
+// startTailState 为文件初始化 tail 模式的读取状态，从文件末尾开始只推送之后新增的内容。
+// 对同一个 filePath 重复调用是安全的：一旦已经存在读取状态（无论是单文件模式还是目录
+// 模式建立的），后续调用直接视为空操作，不会重置 offset/lastLine/partial，
+// 否则例如客户端先通过 WatchDir 发现文件、再 subscribe 触发 WatchFile 时，
+// 会把已经在推进的行号清零、丢掉尚未写出的半行缓冲。
+func (fw *FileWatcher) startTailState(filePath string, followRotation bool) error {
+	fw.tailMutex.Lock()
+	_, exists := fw.tails[filePath]
+	fw.tailMutex.Unlock()
+	if exists {
+		return nil
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+
+	fw.tailMutex.Lock()
+	if _, exists := fw.tails[filePath]; exists {
+		fw.tailMutex.Unlock()
+		return nil
+	}
+	fw.tails[filePath] = &tailState{
+		info:           info,
+		offset:         info.Size(),
+		followRotation: followRotation,
+	}
+	fw.tailMutex.Unlock()
+
+	fw.modesMutex.Lock()
+	fw.modes[filePath] = ModeTail
+	fw.modesMutex.Unlock()
+	return nil
+}
+
+// handleTailChange 处理追加模式下的文件变化：检测轮转，读取并发出新增的行
+func (fw *FileWatcher) handleTailChange(filePath string, callback func(FileChange)) {
+	fw.tailMutex.Lock()
+	state, ok := fw.tails[filePath]
+	fw.tailMutex.Unlock()
+	if !ok {
+		return
+	}
+
+	newInfo, err := os.Stat(filePath)
+	if err != nil {
+		log.Printf("获取文件信息失败 %s: %v", filePath, err)
+		return
+	}
+
+	rotated := false
+	if state.followRotation {
+		// 通过 inode（SameFile）和文件大小回退来判断日志是否发生了轮转/截断
+		rotated = (state.info != nil && !os.SameFile(state.info, newInfo)) || newInfo.Size() < state.offset
+	} else if newInfo.Size() < state.offset {
+		// 未开启轮转检测时，静默重置偏移量，不产生 rotated 事件
+		fw.tailMutex.Lock()
+		state.offset = newInfo.Size()
+		state.info = newInfo
+		fw.tailMutex.Unlock()
+	}
+
+	if rotated {
+		log.Printf("检测到日志轮转: %s", filePath)
+		fw.tailMutex.Lock()
+		state.offset = 0
+		state.lastLine = 0
+		state.partial = nil
+		fw.tailMutex.Unlock()
+		if callback != nil {
+			callback(FileChange{Path: filePath, Op: "rotated", FileInfo: newInfo})
+		}
+	}
+
+	if newInfo.Size() <= state.offset {
+		fw.tailMutex.Lock()
+		state.info = newInfo
+		fw.tailMutex.Unlock()
+		return
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		log.Printf("打开文件失败 %s: %v", filePath, err)
+		return
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(state.offset, io.SeekStart); err != nil {
+		log.Printf("定位文件偏移失败 %s: %v", filePath, err)
+		return
+	}
+
+	appended := make([]byte, newInfo.Size()-state.offset)
+	n, err := io.ReadFull(file, appended)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		log.Printf("读取新增内容失败 %s: %v", filePath, err)
+		return
+	}
+	appended = appended[:n]
+
+	fw.tailMutex.Lock()
+	changes := fw.splitAppendedLines(state, appended)
+	state.offset += int64(n)
+	state.info = newInfo
+	fw.tailMutex.Unlock()
+
+	if len(changes) == 0 {
+		return
+	}
+
+	fileChange := FileChange{
+		Path:        filePath,
+		Op:          "modified",
+		LineChanges: changes,
+		FileInfo:    newInfo,
+	}
+	if callback != nil {
+		callback(fileChange)
+	}
+}
+
+// splitAppendedLines 将新读到的字节与上次残留的未完成行拼接，按 \n 切分出完整行
+// 调用方需持有 fw.tailMutex
+func (fw *FileWatcher) splitAppendedLines(state *tailState, data []byte) []LineChange {
+	buf := append(state.partial, data...)
+	segments := bytes.Split(buf, []byte("\n"))
+
+	// 最后一段要么是下次要补全的残余内容，要么（以 \n 结尾时）是空字符串
+	state.partial = append([]byte(nil), segments[len(segments)-1]...)
+	complete := segments[:len(segments)-1]
+
+	changes := make([]LineChange, 0, len(complete))
+	for _, line := range complete {
+		state.lastLine++
+		changes = append(changes, LineChange{
+			Type:    "added",
+			NewLine: state.lastLine,
+			NewText: string(line),
+		})
+	}
+	return changes
+}
+
+// watchFileDiff 以全量比对模式监听文件：每次变化都重新读取整个文件并做 LCS 差异比较
+func (fw *FileWatcher) watchFileDiff(filePath string) error {
 	// 首次读取文件内容并缓存
 	content, _, err := fw.readFileContent(filePath)
 	if err != nil {
@@ -123,36 +447,14 @@ func (fw *FileWatcher) WatchFile(filePath string, callback func(FileChange)) err
 	fw.fileCache[filePath] = content
 	fw.cacheMutex.Unlock()
 
-	err = fw.watcher.Add(filePath)
-	if err != nil {
+	if err := fw.watcher.Add(filePath); err != nil {
 		return fmt.Errorf("添加文件监听失败: %v", err)
 	}
-
-	go func() {
-		for {
-			select {
-			case event, ok := <-fw.watcher.Events:
-				if !ok {
-					return
-				}
-				log.Printf("文件变化: %v\n", event.Name)
-				if event.Has(fsnotify.Write) {
-					fw.handleFileChange(event.Name, callback)
-				}
-			case err, ok := <-fw.watcher.Errors:
-				if !ok {
-					return
-				}
-				log.Printf("监听错误: %v\n", err)
-			}
-		}
-	}()
-
 	return nil
 }
 
-// handleFileChange 处理文件变化
-func (fw *FileWatcher) handleFileChange(filePath string, callback func(FileChange)) {
+// handleDiffChange 处理全量比对模式下的文件变化
+func (fw *FileWatcher) handleDiffChange(filePath string, callback func(FileChange)) {
 	// 读取新内容
 	newContent, fileInfo, err := fw.readFileContent(filePath)
 	if err != nil {
@@ -189,7 +491,7 @@ func (fw *FileWatcher) handleFileChange(filePath string, callback func(FileChang
 	}
 }
 
-// readFileContent 读取文件内容
+// readFileContent 读取文件内容，仅用于 diff 模式（限制最大文件大小）
 func (fw *FileWatcher) readFileContent(filePath string) (string, os.FileInfo, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -232,130 +534,304 @@ func max(a, b int) int {
 	return b
 }
 
-// Close 关闭监视器
+// Close 关闭监视器，同时释放所有文件与目录的监听状态
 func (fw *FileWatcher) Close() {
 	fw.watcher.Close()
+	fw.cacheMutex.Lock()
+	fw.fileCache = make(map[string]string)
+	fw.cacheMutex.Unlock()
+	fw.modesMutex.Lock()
+	fw.modes = make(map[string]WatchMode)
+	fw.modesMutex.Unlock()
+	fw.tailMutex.Lock()
+	fw.tails = make(map[string]*tailState)
+	fw.tailMutex.Unlock()
+	fw.callbacksMutex.Lock()
+	fw.callbacks = make(map[string]FileEventCallback)
+	fw.callbacksMutex.Unlock()
+	fw.dirsMutex.Lock()
+	fw.watchedDirs = make(map[string]*dirWatch)
+	fw.dirsMutex.Unlock()
 }
 
-// WatchDirectory 监听目录下所有文件的变化
-func WatchDirectory(dirPath string, callback FileEventCallback) error {
-	watcher, err := fsnotify.NewWatcher()
+// Snapshot 从文件末尾向前分块读取，返回最后 n 行内容，无需把整个文件加载到内存
+func (fw *FileWatcher) Snapshot(path string, n int) ([]string, error) {
+	if n <= 0 {
+		return []string{}, nil
+	}
+
+	file, err := os.Open(path)
 	if err != nil {
-		return fmt.Errorf("创建监听器失败: %v", err)
+		return nil, err
 	}
-	defer watcher.Close()
+	defer file.Close()
 
-	done := make(chan bool)
-	go func() {
-		for {
-			select {
-			case event, ok := <-watcher.Events:
-				if !ok {
-					return
-				}
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
 
-				// 获取操作类型
-				var op string
-				switch {
-				case event.Has(fsnotify.Write):
-					op = "modified"
-				case event.Has(fsnotify.Create):
-					op = "created"
-				case event.Has(fsnotify.Remove):
-					op = "removed"
-				case event.Has(fsnotify.Rename):
-					op = "renamed"
-				default:
-					continue
-				}
+	const chunkSize = 8192
+	var (
+		pos   = info.Size()
+		tail  []byte // 当前读取窗口末尾、尚未被切分成完整行的数据
+		lines []string
+		atEOF = true // 是否仍在处理文件最末尾的换行符
+	)
+
+	for pos > 0 && len(lines) < n {
+		readSize := int64(chunkSize)
+		if readSize > pos {
+			readSize = pos
+		}
+		pos -= readSize
 
-				// 对于删除和重命名操作，无法读取文件内容
-				if op == "removed" || op == "renamed" {
-					change := FileChange{
-						Path: event.Name,
-						Op:   op,
-					}
-					if callback != nil {
-						callback(change)
-					}
-					continue
-				}
+		buf := make([]byte, readSize)
+		if _, err := file.ReadAt(buf, pos); err != nil {
+			return nil, err
+		}
+		buf = append(buf, tail...)
 
-				// 读取文件内容
-				content, fileInfo, err := readFileContent(event.Name)
-				if err != nil {
-					log.Printf("读取文件内容失败 %s: %v", event.Name, err)
-					continue
-				}
+		parts := bytes.Split(buf, []byte("\n"))
+		tail = parts[0] // 可能是被截断的行首，留到下一轮读取时补全
 
-				change := FileChange{
-					Path:     event.Name,
-					Op:       op,
-					Content:  content,
-					FileInfo: fileInfo,
+		for i := len(parts) - 1; i >= 1; i-- {
+			line := parts[i]
+			if atEOF {
+				atEOF = false
+				if len(line) == 0 {
+					continue // 文件末尾换行符产生的空行，忽略
 				}
+			}
+			lines = append(lines, string(line))
+			if len(lines) >= n {
+				break
+			}
+		}
+	}
 
-				if callback != nil {
-					callback(change)
-				}
+	if pos == 0 && len(lines) < n && info.Size() > 0 {
+		lines = append(lines, string(tail))
+	}
 
-			case err, ok := <-watcher.Errors:
-				if !ok {
-					return
-				}
-				log.Printf("监听错误: %v\n", err)
+	// 目前 lines 是从文件末尾往前的倒序，翻转为正常的行顺序
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	return lines, nil
+}
+
+// SearchResult 一次搜索命中的结果
+type SearchResult struct {
+	LineNumber int      `json:"line_number"` // 命中行号（从 1 开始）
+	Text       string   `json:"text"`        // 命中行内容
+	Context    []string `json:"context"`     // 命中行及其上下文
+}
+
+// pendingContext 记录一个已命中但"之后"的上下文还没收集完整的搜索结果
+// idx 指向 results 中对应的元素下标（而非指针，因为 append 扩容会搬动底层数组）
+type pendingContext struct {
+	idx  int
+	need int // 还需要再追加多少行之后的上下文
+}
+
+// Search 在整个文件范围内查找匹配 pattern 的行，返回行号与上下文。
+// 与 Snapshot 一样采用边读边扫描的方式，只在内存里保留最近 contextLines 行
+// 以及尚未收集完"之后"上下文的命中结果，不会把整个文件读入内存，适用于超大日志文件。
+func (fw *FileWatcher) Search(path, pattern string, contextLines int) ([]SearchResult, error) {
+	re, err := compileFilter(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	results := make([]SearchResult, 0)
+	pending := make([]pendingContext, 0)
+	before := make([]string, 0, contextLines) // 最近 contextLines 行，作为下一次命中的"之前"上下文
+
+	lineNo := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+
+		remaining := pending[:0]
+		for _, p := range pending {
+			results[p.idx].Context = append(results[p.idx].Context, line)
+			p.need--
+			if p.need > 0 {
+				remaining = append(remaining, p)
+			}
+		}
+		pending = remaining
+
+		if re.MatchString(line) {
+			ctx := append([]string(nil), before...)
+			ctx = append(ctx, line)
+			results = append(results, SearchResult{LineNumber: lineNo, Text: line, Context: ctx})
+			if contextLines > 0 {
+				pending = append(pending, pendingContext{idx: len(results) - 1, need: contextLines})
+			}
+		}
+
+		if contextLines > 0 {
+			if len(before) == contextLines {
+				before = before[1:]
 			}
+			before = append(before, line)
 		}
-	}()
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
 
-	// 递归添加目录下的所有子目录
-	err = filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
+	return results, nil
+}
+
+// WatchDir 监听整个目录：递归发现新建的子目录，按 Include/Exclude 规则筛选文件，
+// 对匹配的文件使用与单文件模式相同的偏移量追加读取方式，并与 FileWatcher 共享同一份缓存
+func (fw *FileWatcher) WatchDir(root string, opts DirOptions, callback FileEventCallback) error {
+	dw := &dirWatch{opts: opts, callback: callback}
+
+	if err := fw.addDirRecursive(root, dw); err != nil {
+		return err
+	}
+
+	// 对目录下已存在、匹配规则的文件启动 tail 监听
+	if err := fw.tailExistingFiles(root, dw); err != nil {
+		return fmt.Errorf("遍历目录失败: %v", err)
+	}
+
+	return nil
+}
+
+// tailExistingFiles 遍历 root（非 Recursive 模式下只处理 root 本身），对匹配
+// Include/Exclude 规则的已存在文件启动 tail 监听。WatchDir 在启动时用它为整棵
+// 目录树建立初始状态；新建子目录时也要用它补上该子目录里已经存在的文件，
+// 否则 "mkdir 后一次性拷入多个文件" 这种场景下，这些文件永远等不到属于自己的
+// fsnotify.Create 事件，会被静默漏掉。
+func (fw *FileWatcher) tailExistingFiles(root string, dw *dirWatch) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 		if info.IsDir() {
-			err = watcher.Add(path)
-			if err != nil {
-				return fmt.Errorf("添加目录监听失败 %s: %v", path, err)
+			if !dw.opts.Recursive && path != root {
+				return filepath.SkipDir
 			}
-			log.Printf("正在监听目录: %s\n", path)
+			return nil
+		}
+		if !dw.opts.allowed(path) {
+			return nil
+		}
+		if err := fw.startTailState(path, dw.opts.FollowRotation); err != nil {
+			return err
 		}
+		fw.callbacksMutex.Lock()
+		fw.callbacks[path] = dw.callback
+		fw.callbacksMutex.Unlock()
 		return nil
 	})
+}
 
-	if err != nil {
-		return fmt.Errorf("遍历目录失败: %v", err)
+// addDirRecursive 将目录（及其在 Recursive 模式下的所有子目录）加入 fsnotify 监听
+func (fw *FileWatcher) addDirRecursive(root string, dw *dirWatch) error {
+	if !dw.opts.Recursive {
+		return fw.addWatchedDir(root, dw)
 	}
 
-	<-done
-	return nil
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		return fw.addWatchedDir(path, dw)
+	})
 }
 
-// readFileContent 读取文件内容
-func readFileContent(filePath string) (string, os.FileInfo, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return "", nil, err
+// addWatchedDir 将单个目录加入 fsnotify 监听并记录其归属
+func (fw *FileWatcher) addWatchedDir(path string, dw *dirWatch) error {
+	if err := fw.watcher.Add(path); err != nil {
+		return fmt.Errorf("添加目录监听失败 %s: %v", path, err)
 	}
-	defer file.Close()
+	fw.dirsMutex.Lock()
+	fw.watchedDirs[path] = dw
+	fw.dirsMutex.Unlock()
+	log.Printf("正在监听目录: %s\n", path)
+	return nil
+}
 
-	// 获取文件信息
-	fileInfo, err := file.Stat()
-	if err != nil {
-		return "", nil, err
-	}
+// handleDirEvent 处理目录监听范围内的事件：新建文件/子目录、写入、删除
+func (fw *FileWatcher) handleDirEvent(event fsnotify.Event, dw *dirWatch) {
+	path := event.Name
 
-	// 如果文件太大，可能需要限制读取大小
-	maxSize := int64(10 * 1024 * 1024) // 10MB
-	if fileInfo.Size() > maxSize {
-		return "", fileInfo, fmt.Errorf("文件太大: %d > %d", fileInfo.Size(), maxSize)
-	}
+	switch {
+	case event.Has(fsnotify.Create):
+		info, err := os.Stat(path)
+		if err != nil {
+			log.Printf("获取文件信息失败 %s: %v", path, err)
+			return
+		}
+		if info.IsDir() {
+			if dw.opts.Recursive {
+				if err := fw.addDirRecursive(path, dw); err != nil {
+					log.Printf("添加目录监听失败 %s: %v", path, err)
+					return
+				}
+				// 新目录在加入监听之前可能已经被一次性写入了文件（如 mkdir -p
+				// 后紧接着拷贝/解压），这些文件不会再单独触发 Create 事件，
+				// 必须主动补一次扫描才能开始 tail
+				if err := fw.tailExistingFiles(path, dw); err != nil {
+					log.Printf("遍历新增目录失败 %s: %v", path, err)
+				}
+			}
+			return
+		}
+		if !dw.opts.allowed(path) {
+			return
+		}
+		if err := fw.startTailState(path, dw.opts.FollowRotation); err != nil {
+			log.Printf("监听新增文件失败 %s: %v", path, err)
+			return
+		}
+		fw.callbacksMutex.Lock()
+		fw.callbacks[path] = dw.callback
+		fw.callbacksMutex.Unlock()
+		if dw.callback != nil {
+			dw.callback(FileChange{Path: path, Op: "created", FileInfo: info})
+		}
 
-	// 读取文件内容
-	content, err := io.ReadAll(file)
-	if err != nil {
-		return "", fileInfo, err
+	case event.Has(fsnotify.Write):
+		if !dw.opts.allowed(path) {
+			return
+		}
+		fw.handleTailChange(path, dw.callback)
+
+	case event.Has(fsnotify.Remove), event.Has(fsnotify.Rename):
+		fw.tailMutex.Lock()
+		delete(fw.tails, path)
+		fw.tailMutex.Unlock()
+		fw.modesMutex.Lock()
+		delete(fw.modes, path)
+		fw.modesMutex.Unlock()
+		fw.callbacksMutex.Lock()
+		delete(fw.callbacks, path)
+		fw.callbacksMutex.Unlock()
+
+		if dw.callback != nil {
+			op := "removed"
+			if event.Has(fsnotify.Rename) {
+				op = "renamed"
+			}
+			dw.callback(FileChange{Path: path, Op: op})
+		}
 	}
-
-	return string(content), fileInfo, nil
 }
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSplitAppendedLines(t *testing.T) {
+	fw := &FileWatcher{}
+	state := &tailState{}
+
+	changes := fw.splitAppendedLines(state, []byte("line1\nline2\n"))
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 complete lines, got %d", len(changes))
+	}
+	if changes[0].NewLine != 1 || changes[0].NewText != "line1" {
+		t.Errorf("unexpected first change: %+v", changes[0])
+	}
+	if changes[1].NewLine != 2 || changes[1].NewText != "line2" {
+		t.Errorf("unexpected second change: %+v", changes[1])
+	}
+	if len(state.partial) != 0 {
+		t.Errorf("expected no partial remainder, got %q", state.partial)
+	}
+}
+
+func TestSplitAppendedLinesPartialLine(t *testing.T) {
+	fw := &FileWatcher{}
+	state := &tailState{}
+
+	// 第一次写入只到行中间，没有换行符
+	changes := fw.splitAppendedLines(state, []byte("hello "))
+	if len(changes) != 0 {
+		t.Fatalf("expected no complete lines yet, got %d", len(changes))
+	}
+	if string(state.partial) != "hello " {
+		t.Fatalf("expected partial %q, got %q", "hello ", state.partial)
+	}
+
+	// 第二次写入补全了这一行，并追加了新的一行
+	changes = fw.splitAppendedLines(state, []byte("world\nsecond\n"))
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 complete lines, got %d", len(changes))
+	}
+	if changes[0].NewText != "hello world" {
+		t.Errorf("expected partial line to be joined, got %q", changes[0].NewText)
+	}
+	if changes[0].NewLine != 1 || changes[1].NewLine != 2 {
+		t.Errorf("expected lastLine to keep incrementing across calls, got %+v / %+v", changes[0], changes[1])
+	}
+}
+
+func TestSplitAppendedLinesNoTrailingNewline(t *testing.T) {
+	fw := &FileWatcher{}
+	state := &tailState{}
+
+	changes := fw.splitAppendedLines(state, []byte("complete\nincomplete"))
+	if len(changes) != 1 {
+		t.Fatalf("expected 1 complete line, got %d", len(changes))
+	}
+	if string(state.partial) != "incomplete" {
+		t.Fatalf("expected partial %q, got %q", "incomplete", state.partial)
+	}
+}
+
+func writeTempFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "sample.log")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write temp file: %v", err)
+	}
+	return path
+}
+
+func TestSnapshotReturnsLastNLines(t *testing.T) {
+	fw := &FileWatcher{}
+	path := writeTempFile(t, "line1\nline2\nline3\nline4\n")
+
+	lines, err := fw.Snapshot(path, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"line3", "line4"}
+	if strings.Join(lines, ",") != strings.Join(want, ",") {
+		t.Errorf("expected %v, got %v", want, lines)
+	}
+}
+
+func TestSnapshotFewerLinesThanRequested(t *testing.T) {
+	fw := &FileWatcher{}
+	path := writeTempFile(t, "only\n")
+
+	lines, err := fw.Snapshot(path, 5)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(lines) != 1 || lines[0] != "only" {
+		t.Errorf("expected [only], got %v", lines)
+	}
+}
+
+func TestSnapshotSpansMultipleChunks(t *testing.T) {
+	fw := &FileWatcher{}
+	// 确保内容超过 Snapshot 内部的 chunkSize（8192 字节），覆盖跨块拼接的情况
+	var b strings.Builder
+	for i := 0; i < 2000; i++ {
+		b.WriteString("line-padding-to-force-multiple-chunks\n")
+	}
+	b.WriteString("last-line\n")
+	path := writeTempFile(t, b.String())
+
+	lines, err := fw.Snapshot(path, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(lines) != 1 || lines[0] != "last-line" {
+		t.Errorf("expected [last-line], got %v", lines)
+	}
+}
+
+func TestSearchFindsMatchesWithContext(t *testing.T) {
+	fw := &FileWatcher{}
+	path := writeTempFile(t, "one\ntwo ERROR\nthree\nfour ERROR\nfive\n")
+
+	results, err := fw.Search(path, "ERROR", 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 matches, got %d", len(results))
+	}
+
+	if results[0].LineNumber != 2 || results[0].Text != "two ERROR" {
+		t.Errorf("unexpected first result: %+v", results[0])
+	}
+	if strings.Join(results[0].Context, ",") != "one,two ERROR,three" {
+		t.Errorf("unexpected context for first result: %v", results[0].Context)
+	}
+
+	if results[1].LineNumber != 4 || results[1].Text != "four ERROR" {
+		t.Errorf("unexpected second result: %+v", results[1])
+	}
+	if strings.Join(results[1].Context, ",") != "three,four ERROR,five" {
+		t.Errorf("unexpected context for second result: %v", results[1].Context)
+	}
+}
+
+func TestSearchNoMatches(t *testing.T) {
+	fw := &FileWatcher{}
+	path := writeTempFile(t, "nothing\nto\nsee\n")
+
+	results, err := fw.Search(path, "ERROR", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 0 {
+		t.Errorf("expected no matches, got %d", len(results))
+	}
+}
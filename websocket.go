@@ -1,39 +1,65 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"net/http"
 	"sync"
+	"sync/atomic"
 
 	"github.com/gorilla/websocket"
 )
 
 // Client 表示一个WebSocket客户端连接
 type Client struct {
+	sid  string // 会话 ID
 	conn *websocket.Conn
 	send chan []byte
 }
 
+// subscription 一个会话对某个文件路径的订阅，携带可选的行过滤条件
+type subscription struct {
+	client *Client
+	filter *lineFilter
+}
+
+// pathMessage 某个文件路径发生的一次变化，等待按订阅者的过滤条件分别推送
+type pathMessage struct {
+	path   string
+	change FileChange
+}
+
 // WebSocketServer WebSocket服务器结构
 type WebSocketServer struct {
-	upgrader  websocket.Upgrader
-	clients   map[*Client]bool
-	broadcast chan []byte
+	upgrader websocket.Upgrader
+
+	clients  map[*Client]bool   // 所有连接中的客户端
+	sessions map[string]*Client // 会话 ID -> 客户端
+
+	// subscriptions 记录每个文件路径被哪些会话订阅了，以及各自的过滤条件；
+	// 文件变化只会推送给订阅了对应路径、且满足过滤条件的客户端
+	subscriptions map[string]map[string]*subscription
+
+	broadcast chan pathMessage
 	mutex     sync.Mutex
-	handler   func([]byte) ([]byte, error)
+
+	sidCounter uint64
+	router     *Router
 }
 
-// NewWebSocketServer 创建新的WebSocket服务器
-func NewWebSocketServer(handler func([]byte) ([]byte, error)) *WebSocketServer {
+// NewWebSocketServer 创建新的WebSocket服务器，消息的分发逻辑由 router 决定
+func NewWebSocketServer(router *Router) *WebSocketServer {
 	return &WebSocketServer{
 		upgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool {
 				return true
 			},
 		},
-		clients:   make(map[*Client]bool),
-		broadcast: make(chan []byte),
-		handler:   handler,
+		clients:       make(map[*Client]bool),
+		sessions:      make(map[string]*Client),
+		subscriptions: make(map[string]map[string]*subscription),
+		broadcast:     make(chan pathMessage),
+		router:        router,
 	}
 }
 
@@ -45,32 +71,34 @@ func (s *WebSocketServer) HandleWebSocket(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	sid := s.nextSessionID()
 	client := &Client{
+		sid:  sid,
 		conn: conn,
 		send: make(chan []byte, 256),
 	}
 
 	s.mutex.Lock()
 	s.clients[client] = true
+	s.sessions[sid] = client
 	s.mutex.Unlock()
 
-	log.Printf("新客户端连接: %s", conn.RemoteAddr().String())
+	log.Printf("新客户端连接: %s (session=%s)", conn.RemoteAddr().String(), sid)
 
 	// 启动读取和写入的 goroutines
 	go s.handleClientRead(client)
 	go s.handleClientWrite(client)
 }
 
+// nextSessionID 生成一个新的会话 ID
+func (s *WebSocketServer) nextSessionID() string {
+	id := atomic.AddUint64(&s.sidCounter, 1)
+	return fmt.Sprintf("sess-%d", id)
+}
+
 // handleClientRead 处理客户端的读取消息
 func (s *WebSocketServer) handleClientRead(client *Client) {
-	defer func() {
-		s.mutex.Lock()
-		delete(s.clients, client)
-		s.mutex.Unlock()
-		close(client.send) // 关闭发送通道
-		client.conn.Close()
-		log.Printf("客户端断开连接: %s", client.conn.RemoteAddr().String())
-	}()
+	defer s.removeClient(client)
 
 	for {
 		_, message, err := client.conn.ReadMessage()
@@ -81,18 +109,31 @@ func (s *WebSocketServer) handleClientRead(client *Client) {
 			break
 		}
 
-		// 处理消息
-		response, err := s.handler(message)
-		if err != nil {
-			log.Printf("处理消息错误: %v", err)
-			continue
-		}
-
-		// 发送响应到客户端的发送通道
+		// 通过 router 分发消息，得到的响应帧（或错误帧）直接发给客户端
+		ctx := &Context{SID: client.sid, Server: s, Client: client}
+		response := s.router.Dispatch(ctx, message)
 		client.send <- response
 	}
 }
 
+// removeClient 清理客户端连接及其所有订阅
+func (s *WebSocketServer) removeClient(client *Client) {
+	s.mutex.Lock()
+	delete(s.clients, client)
+	delete(s.sessions, client.sid)
+	for path, subs := range s.subscriptions {
+		delete(subs, client.sid)
+		if len(subs) == 0 {
+			delete(s.subscriptions, path)
+		}
+	}
+	s.mutex.Unlock()
+
+	close(client.send) // 关闭发送通道
+	client.conn.Close()
+	log.Printf("客户端断开连接: %s (session=%s)", client.conn.RemoteAddr().String(), client.sid)
+}
+
 // handleClientWrite 处理客户端的写入消息
 func (s *WebSocketServer) handleClientWrite(client *Client) {
 	defer func() {
@@ -111,18 +152,84 @@ func (s *WebSocketServer) handleClientWrite(client *Client) {
 	client.conn.WriteMessage(websocket.CloseMessage, []byte{})
 }
 
-// BroadcastMessages 广播消息给所有连接的客户端
+// Subscribe 让指定会话订阅某个文件路径的变化，filter 为 nil 表示不过滤
+func (s *WebSocketServer) Subscribe(sid, path string, filter *lineFilter) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	client, ok := s.sessions[sid]
+	if !ok {
+		return
+	}
+
+	subs, ok := s.subscriptions[path]
+	if !ok {
+		subs = make(map[string]*subscription)
+		s.subscriptions[path] = subs
+	}
+	subs[sid] = &subscription{client: client, filter: filter}
+}
+
+// Unsubscribe 取消指定会话对某个文件路径的订阅
+func (s *WebSocketServer) Unsubscribe(sid, path string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	subs, ok := s.subscriptions[path]
+	if !ok {
+		return
+	}
+	delete(subs, sid)
+	if len(subs) == 0 {
+		delete(s.subscriptions, path)
+	}
+}
+
+// ListWatches 返回指定会话当前订阅的所有文件路径
+func (s *WebSocketServer) ListWatches(sid string) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	paths := make([]string, 0)
+	for path, subs := range s.subscriptions {
+		if _, ok := subs[sid]; ok {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// PublishChange 将一次文件变化推送给订阅了该路径、且满足各自过滤条件的客户端
+func (s *WebSocketServer) PublishChange(change FileChange) {
+	s.broadcast <- pathMessage{path: change.Path, change: change}
+}
+
+// BroadcastMessages 按每个订阅者的过滤条件分别筛选并推送文件变化
 func (s *WebSocketServer) BroadcastMessages() {
-	for {
-		message := <-s.broadcast
+	for msg := range s.broadcast {
 		s.mutex.Lock()
-		for client := range s.clients {
+		for _, sub := range s.subscriptions[msg.path] {
+			filtered := filterChange(msg.change, sub.filter)
+			if filtered == nil {
+				continue // 本次变化被过滤条件排除，不推送给该订阅者
+			}
+
+			data, err := encodeEvent(msg.path, *filtered)
+			if err != nil {
+				log.Printf("encodeEvent(%s) error: %v", msg.path, err)
+				continue
+			}
+
+			client := sub.client
 			select {
-			case client.send <- message:
+			case client.send <- data:
 			default:
-				// 如果客户端的发送缓冲区已满，关闭连接
-				close(client.send)
-				delete(s.clients, client)
+				// 发送缓冲区已满：只关闭连接，不在这里动 client.send 或订阅表。
+				// client 可能同时订阅了其他路径，这里若直接 close(client.send) 或清理
+				// subscriptions，会与 handleClientRead 的 defer removeClient 产生重复
+				// 清理（重复 close 的 channel panic）或让其他路径上的 select 命中一个
+				// 已关闭的 send channel（同样 panic）。关闭连接会让 ReadMessage 出错，
+				// 由 removeClient 统一、且只执行一次地完成清理。
 				client.conn.Close()
 			}
 		}
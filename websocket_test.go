@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func newTestServerWithClient(sid string) (*WebSocketServer, *Client) {
+	s := NewWebSocketServer(NewRouter())
+	client := &Client{sid: sid, send: make(chan []byte, 8)}
+	s.clients[client] = true
+	s.sessions[sid] = client
+	return s, client
+}
+
+func TestSubscribeUnsubscribeListWatches(t *testing.T) {
+	s, _ := newTestServerWithClient("sess-1")
+
+	s.Subscribe("sess-1", "/var/log/a.log", nil)
+	s.Subscribe("sess-1", "/var/log/b.log", nil)
+
+	watches := s.ListWatches("sess-1")
+	if len(watches) != 2 {
+		t.Fatalf("expected 2 watched paths, got %d: %v", len(watches), watches)
+	}
+
+	s.Unsubscribe("sess-1", "/var/log/a.log")
+	watches = s.ListWatches("sess-1")
+	if len(watches) != 1 || watches[0] != "/var/log/b.log" {
+		t.Fatalf("expected only b.log left, got %v", watches)
+	}
+
+	// 取消一个不存在的订阅/未知会话应当是安全的空操作
+	s.Unsubscribe("sess-1", "/var/log/does-not-exist.log")
+	s.Unsubscribe("sess-unknown", "/var/log/b.log")
+}
+
+func TestSubscribeUnknownSessionIsNoop(t *testing.T) {
+	s := NewWebSocketServer(NewRouter())
+	s.Subscribe("no-such-session", "/var/log/a.log", nil)
+	if len(s.subscriptions) != 0 {
+		t.Errorf("expected no subscription to be recorded for an unknown session, got %v", s.subscriptions)
+	}
+}
+
+func drainOne(t *testing.T, ch chan []byte) map[string]interface{} {
+	t.Helper()
+	select {
+	case data := <-ch:
+		var decoded map[string]interface{}
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("failed to decode pushed event: %v", err)
+		}
+		return decoded
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for broadcast message")
+		return nil
+	}
+}
+
+func assertNothingReceived(t *testing.T, ch chan []byte) {
+	t.Helper()
+	select {
+	case data := <-ch:
+		t.Fatalf("expected no message, got %s", data)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestBroadcastMessagesRoutesToSubscribersOnly(t *testing.T) {
+	s, clientA := newTestServerWithClient("sess-a")
+	_, clientB := newTestServerWithClient("sess-b")
+	s.clients[clientB] = true
+	s.sessions["sess-b"] = clientB
+
+	s.Subscribe("sess-a", "/var/log/a.log", nil)
+	s.Subscribe("sess-b", "/var/log/b.log", nil)
+
+	go s.BroadcastMessages()
+
+	s.PublishChange(FileChange{Path: "/var/log/a.log", Op: "modified", LineChanges: []LineChange{{Type: "added", NewText: "hello"}}})
+
+	event := drainOne(t, clientA.send)
+	if event["channel"] != "/var/log/a.log" {
+		t.Errorf("expected event for a.log, got %v", event["channel"])
+	}
+	assertNothingReceived(t, clientB.send)
+}
+
+func TestBroadcastMessagesAppliesPerSubscriberFilter(t *testing.T) {
+	s, clientMatch := newTestServerWithClient("sess-match")
+	_, clientNoMatch := newTestServerWithClient("sess-no-match")
+	s.clients[clientNoMatch] = true
+	s.sessions["sess-no-match"] = clientNoMatch
+
+	matchFilter, err := buildLineFilter("ERROR", "", "")
+	if err != nil {
+		t.Fatalf("unexpected error building filter: %v", err)
+	}
+	noMatchFilter, err := buildLineFilter("NEVER", "", "")
+	if err != nil {
+		t.Fatalf("unexpected error building filter: %v", err)
+	}
+
+	s.Subscribe("sess-match", "/var/log/app.log", matchFilter)
+	s.Subscribe("sess-no-match", "/var/log/app.log", noMatchFilter)
+
+	go s.BroadcastMessages()
+
+	s.PublishChange(FileChange{
+		Path:        "/var/log/app.log",
+		Op:          "modified",
+		LineChanges: []LineChange{{Type: "added", NewText: "ERROR something broke"}},
+	})
+
+	drainOne(t, clientMatch.send)
+	assertNothingReceived(t, clientNoMatch.send)
+}